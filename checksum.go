@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/robertojrojas/nexus-haul/internal/xfer"
+)
+
+// ChecksumMismatchError is returned when a source-provided checksum sidecar
+// does not match the digest computed from the bytes actually streamed.
+type ChecksumMismatchError struct {
+	Algo     string
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch for %s: source says [%s], got [%s]", e.Algo, e.URL, e.Expected, e.Actual)
+}
+
+// Retryable is always false: re-streaming the same source bytes would
+// produce the same mismatch.
+func (e *ChecksumMismatchError) Retryable() bool { return false }
+
+// hashSet accumulates one or more digests over a single stream of bytes.
+type hashSet struct {
+	hashes map[string]hash.Hash
+}
+
+func newHashSet(algos []string) *hashSet {
+	hs := &hashSet{hashes: make(map[string]hash.Hash, len(algos))}
+	for _, algo := range algos {
+		switch strings.ToLower(algo) {
+		case "md5":
+			hs.hashes[algo] = md5.New()
+		case "sha1":
+			hs.hashes[algo] = sha1.New()
+		case "sha256":
+			hs.hashes[algo] = sha256.New()
+		}
+	}
+	return hs
+}
+
+// Writer returns an io.Writer that feeds every configured digest.
+func (hs *hashSet) Writer() io.Writer {
+	writers := make([]io.Writer, 0, len(hs.hashes))
+	for _, h := range hs.hashes {
+		writers = append(writers, h)
+	}
+	return io.MultiWriter(writers...)
+}
+
+// Sums returns the hex-encoded digest for each configured algorithm.
+func (hs *hashSet) Sums() map[string]string {
+	sums := make(map[string]string, len(hs.hashes))
+	for algo, h := range hs.hashes {
+		sums[algo] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums
+}
+
+// expectedChecksums fetches the source-published sidecar for each algorithm
+// configured on assetToStream, ahead of streaming the artifact itself, so a
+// mismatch can be caught before anything is PUT to the target. An algorithm
+// with no source sidecar (404) is simply absent from the result: its
+// sidecar will be generated from the bytes actually streamed instead.
+func expectedChecksums(ctx context.Context, assetToStream AssetToStream) (map[string]string, error) {
+	expected := make(map[string]string, len(assetToStream.hashes))
+	for _, algo := range assetToStream.hashes {
+		sourceSidecarURL := assetToStream.sourceURL + "." + strings.ToLower(algo)
+
+		data, status, err := fetchSidecar(ctx, sourceSidecarURL)
+		if err != nil {
+			return nil, err
+		}
+
+		switch status {
+		case http.StatusOK:
+			if published := strings.Fields(string(data)); len(published) > 0 {
+				expected[algo] = published[0]
+			}
+		case http.StatusNotFound:
+			// Source has no sidecar; its digest will be generated instead.
+		default:
+			return nil, &xfer.HTTPError{URL: sourceSidecarURL, StatusCode: status, Body: string(data)}
+		}
+	}
+	return expected, nil
+}
+
+// verifyChecksums compares each expected digest against what was actually
+// computed while streaming the artifact, returning a ChecksumMismatchError
+// for the first disagreement.
+func verifyChecksums(assetToStream AssetToStream, expected, computed map[string]string) error {
+	for algo, expectedHex := range expected {
+		if !strings.EqualFold(expectedHex, computed[algo]) {
+			return &ChecksumMismatchError{Algo: algo, URL: assetToStream.sourceURL, Expected: expectedHex, Actual: computed[algo]}
+		}
+	}
+	return nil
+}
+
+// streamSidecars uploads a checksum sidecar file to the target for each
+// algorithm configured on assetToStream: the source-published value when
+// there was one, otherwise the digest computed from the bytes actually
+// streamed.
+func streamSidecars(ctx context.Context, assetToStream AssetToStream, expected, computed map[string]string) error {
+	for _, algo := range assetToStream.hashes {
+		payload, ok := expected[algo]
+		if !ok {
+			payload, ok = computed[algo]
+		}
+		if !ok {
+			continue
+		}
+
+		targetSidecarURL := assetToStream.targetURL + "." + strings.ToLower(algo)
+		if err := httpUpload(ctx, targetSidecarURL, strings.NewReader(payload), "text/plain"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchSidecar GETs a checksum sidecar from the source and returns its raw
+// body and status code, leaving 404 handling to the caller.
+func fetchSidecar(ctx context.Context, url string) ([]byte, int, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.SetBasicAuth(ci.authFile.SourceUser, ci.authFile.SourcePassword)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return data, resp.StatusCode, nil
+}
@@ -0,0 +1,71 @@
+package repoformat
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Maven2 is the original nexus-haul behavior: it walks the Nexus
+// GAV tree API and mirrors .jar/.pom artifacts into a maven2-layout
+// target.
+type Maven2 struct{}
+
+func (m *Maven2) Name() string { return "maven2" }
+
+func (m *Maven2) ListURL(sourceURL, path string) string {
+	return sourceURL + path
+}
+
+// maven2Data/maven2Node mirror the JSON shape returned by Nexus's GAV tree
+// browse API ("/service/local/repositories/<repo>/content-compressed/...").
+type maven2Data struct {
+	Asset maven2Node `json:"data"`
+}
+
+type maven2Node struct {
+	Type     string       `json:"type"`
+	Leaf     bool         `json:"leaf"`
+	Path     string       `json:"path"`
+	Children []maven2Node `json:"children"`
+	PomUri   string       `json:"pomUri"`
+}
+
+func (m *Maven2) ParseListing(data []byte) (Asset, error) {
+	var d maven2Data
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Asset{}, err
+	}
+	return maven2ToAsset(d.Asset), nil
+}
+
+func maven2ToAsset(n maven2Node) Asset {
+	asset := Asset{Path: stripLeadingSlash(n.Path), Leaf: n.Leaf}
+	for _, c := range n.Children {
+		if c.Leaf {
+			artifactPath := stripLeadingSlash(c.Path)
+			asset.Children = append(asset.Children, Asset{Path: artifactPath, Leaf: true})
+			if len(c.PomUri) > 0 {
+				pomPath := strings.TrimSuffix(artifactPath, ".jar") + ".pom"
+				asset.Children = append(asset.Children, Asset{Path: pomPath, Leaf: true})
+			}
+		} else {
+			asset.Children = append(asset.Children, maven2ToAsset(c))
+		}
+	}
+	return asset
+}
+
+func (m *Maven2) DownloadURL(sourceDownloadURL string, asset Asset) string {
+	return sourceDownloadURL + asset.Path
+}
+
+func (m *Maven2) UploadURL(targetURL string, asset Asset) string {
+	return targetURL + asset.Path
+}
+
+func (m *Maven2) ContentType(asset Asset) string {
+	if strings.HasSuffix(asset.Path, ".pom") {
+		return "application/xml"
+	}
+	return "application/java-archive"
+}
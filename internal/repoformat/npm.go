@@ -0,0 +1,69 @@
+package repoformat
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// NPM mirrors one npm package: SourceURL names a single package, and its
+// packument lists one tarball per published version, with no further
+// grouping to walk. Migrating a whole registry means running nexus-haul
+// once per package.
+type NPM struct{}
+
+func (n *NPM) Name() string { return "npm" }
+
+func (n *NPM) ListURL(sourceURL, path string) string {
+	return sourceURL + path
+}
+
+// npmPackument is the relevant subset of an npm registry packument
+// ("GET /<package>").
+type npmPackument struct {
+	Versions map[string]npmVersion `json:"versions"`
+}
+
+type npmVersion struct {
+	Dist struct {
+		Tarball string `json:"tarball"`
+	} `json:"dist"`
+}
+
+func (n *NPM) ParseListing(data []byte) (Asset, error) {
+	var packument npmPackument
+	if err := json.Unmarshal(data, &packument); err != nil {
+		return Asset{}, err
+	}
+
+	versions := make([]string, 0, len(packument.Versions))
+	for v := range packument.Versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	root := Asset{}
+	for _, v := range versions {
+		tarball := packument.Versions[v].Dist.Tarball
+		if tarball == "" {
+			continue
+		}
+		root.Children = append(root.Children, Asset{Path: tarball, Leaf: true})
+	}
+	return root, nil
+}
+
+// DownloadURL ignores sourceDownloadURL: npm dist.tarball entries are
+// already absolute URLs.
+func (n *NPM) DownloadURL(sourceDownloadURL string, asset Asset) string {
+	return asset.Path
+}
+
+// UploadURL mirrors the tarball under its file name: asset.Path is the
+// absolute source tarball URL, not a target-relative path.
+func (n *NPM) UploadURL(targetURL string, asset Asset) string {
+	return targetURL + filenameOf(asset.Path)
+}
+
+func (n *NPM) ContentType(asset Asset) string {
+	return "application/octet-stream"
+}
@@ -0,0 +1,61 @@
+package repoformat
+
+import "encoding/json"
+
+// PyPI mirrors one PyPI project: SourceURL names a single project, and its
+// simple-API JSON index (PEP 691) lists that project's distribution files
+// in index order, with no further grouping to walk. Migrating a whole
+// index means running nexus-haul once per project.
+type PyPI struct{}
+
+func (p *PyPI) Name() string { return "pypi" }
+
+func (p *PyPI) ListURL(sourceURL, path string) string {
+	return sourceURL + path
+}
+
+// pypiSimpleIndex is the relevant subset of a PEP 691 simple-API response.
+type pypiSimpleIndex struct {
+	Files []pypiFile `json:"files"`
+}
+
+type pypiFile struct {
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+}
+
+func (p *PyPI) ParseListing(data []byte) (Asset, error) {
+	var index pypiSimpleIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return Asset{}, err
+	}
+
+	root := Asset{}
+	for _, f := range index.Files {
+		if f.URL == "" {
+			continue
+		}
+		root.Children = append(root.Children, Asset{Path: f.URL, Leaf: true})
+	}
+	return root, nil
+}
+
+// DownloadURL returns asset.Path as-is when the simple-API already gave an
+// absolute URL; PEP 691 also allows index-relative file URLs, so those are
+// resolved against sourceDownloadURL.
+func (p *PyPI) DownloadURL(sourceDownloadURL string, asset Asset) string {
+	if isAbsoluteURL(asset.Path) {
+		return asset.Path
+	}
+	return sourceDownloadURL + asset.Path
+}
+
+// UploadURL mirrors the file under its file name: asset.Path is a source
+// URL (absolute or index-relative), not a target-relative path.
+func (p *PyPI) UploadURL(targetURL string, asset Asset) string {
+	return targetURL + filenameOf(asset.Path)
+}
+
+func (p *PyPI) ContentType(asset Asset) string {
+	return "application/octet-stream"
+}
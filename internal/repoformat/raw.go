@@ -0,0 +1,52 @@
+package repoformat
+
+import "encoding/json"
+
+// Raw mirrors a Nexus raw repository, which has no GAV structure: assets
+// are arbitrary paths, mirrored byte-for-byte.
+type Raw struct{}
+
+func (r *Raw) Name() string { return "raw" }
+
+func (r *Raw) ListURL(sourceURL, path string) string {
+	return sourceURL + path
+}
+
+// rawListing is the shape of Nexus's raw-repository directory browse
+// response: a flat list of entries, each either a "file" or a "folder".
+type rawListing struct {
+	Items []rawItem `json:"items"`
+}
+
+type rawItem struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+}
+
+func (r *Raw) ParseListing(data []byte) (Asset, error) {
+	var listing rawListing
+	if err := json.Unmarshal(data, &listing); err != nil {
+		return Asset{}, err
+	}
+
+	root := Asset{}
+	for _, item := range listing.Items {
+		root.Children = append(root.Children, Asset{
+			Path: stripLeadingSlash(item.Path),
+			Leaf: item.Type != "folder",
+		})
+	}
+	return root, nil
+}
+
+func (r *Raw) DownloadURL(sourceDownloadURL string, asset Asset) string {
+	return sourceDownloadURL + asset.Path
+}
+
+func (r *Raw) UploadURL(targetURL string, asset Asset) string {
+	return targetURL + asset.Path
+}
+
+func (r *Raw) ContentType(asset Asset) string {
+	return "application/octet-stream"
+}
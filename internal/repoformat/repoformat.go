@@ -0,0 +1,116 @@
+// Package repoformat abstracts over the different Nexus repository formats
+// (maven2, raw, npm, pypi, ...) that nexus-haul can migrate, so the
+// migration pipeline in main can walk and stream any of them without
+// knowing their URL layout or content types.
+package repoformat
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Asset is a node in a repository's listing tree: either a leaf (an actual
+// file to migrate) or a group containing further children.
+type Asset struct {
+	Path     string
+	Leaf     bool
+	Children []Asset
+}
+
+// Format knows how to list, address, and upload the assets of one
+// repository format.
+type Format interface {
+	// Name identifies the format, as used in configFile.Format.
+	Name() string
+	// ListURL builds the URL used to list the children of the group at
+	// path, relative to sourceURL.
+	ListURL(sourceURL, path string) string
+	// ParseListing parses one listing response into an Asset tree.
+	ParseListing(data []byte) (Asset, error)
+	// DownloadURL builds the absolute source URL to fetch asset's bytes
+	// from, relative to sourceDownloadURL.
+	DownloadURL(sourceDownloadURL string, asset Asset) string
+	// UploadURL builds the absolute target URL to PUT asset's bytes to,
+	// relative to targetURL.
+	UploadURL(targetURL string, asset Asset) string
+	// ContentType returns the Content-Type to send when uploading asset.
+	ContentType(asset Asset) string
+}
+
+// New constructs the Format named by name. An empty name defaults to
+// maven2, matching nexus-haul's original, Maven-only behavior.
+func New(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "maven2":
+		return &Maven2{}, nil
+	case "raw":
+		return &Raw{}, nil
+	case "npm":
+		return &NPM{}, nil
+	case "pypi":
+		return &PyPI{}, nil
+	default:
+		return nil, fmt.Errorf("unknown repository format %q", name)
+	}
+}
+
+// Artifacts returns every leaf Asset found at or beneath asset.
+func Artifacts(asset Asset) []Asset {
+	var artifacts []Asset
+	for _, child := range asset.Children {
+		if child.Leaf {
+			artifacts = append(artifacts, child)
+		} else {
+			artifacts = append(artifacts, Artifacts(child)...)
+		}
+	}
+	return artifacts
+}
+
+// Groups returns the paths, anywhere in asset's subtree, of group children
+// that still need to be listed themselves: a non-leaf with no Children of
+// its own, because ParseListing only expanded one level (e.g. raw). A
+// non-leaf whose Children are already populated is already fully expanded
+// (e.g. maven2's recursive GAV tree), so Groups recurses into it looking
+// for unexpanded groups deeper down instead of re-listing it.
+func Groups(asset Asset) []string {
+	var groups []string
+	for _, child := range asset.Children {
+		if child.Leaf {
+			continue
+		}
+		if len(child.Children) == 0 {
+			groups = append(groups, child.Path)
+		} else {
+			groups = append(groups, Groups(child)...)
+		}
+	}
+	return groups
+}
+
+// stripLeadingSlash drops a single leading "/", matching the relative-path
+// convention nexus-haul concatenates onto its configured base URLs.
+func stripLeadingSlash(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return p[1:]
+	}
+	return p
+}
+
+// isAbsoluteURL reports whether rawURL already names a scheme and host,
+// as opposed to a path relative to a format's configured base URL.
+func isAbsoluteURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.IsAbs()
+}
+
+// filenameOf returns the last path segment of rawURL (or of a plain path),
+// suitable as the file name to upload an asset under on the target.
+func filenameOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Path != "" {
+		return path.Base(u.Path)
+	}
+	return path.Base(rawURL)
+}
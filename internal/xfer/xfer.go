@@ -0,0 +1,243 @@
+// Package xfer implements a small, resumable transfer manager used to move
+// artifacts from a source Nexus instance to a target one. It tracks each
+// source->target pair as a transfer, bounds how many run concurrently,
+// retries transient failures with exponential backoff, de-duplicates work
+// within a single run, and checkpoints completed transfers to disk so a
+// re-run of nexus-haul can pick up where a previous run left off.
+package xfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle of a single transfer.
+type State int
+
+const (
+	StateQueued State = iota
+	StateInFlight
+	StateSucceeded
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateQueued:
+		return "queued"
+	case StateInFlight:
+		return "in-flight"
+	case StateSucceeded:
+		return "succeeded"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// HTTPError is returned by callers of Manager.Do when a transfer fails with
+// an HTTP status code, so the manager can tell transient server errors
+// (5xx) apart from permanent client errors (4xx).
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("URL:[%s], StatusCode:[%d], [%s]", e.URL, e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the error is worth retrying: server errors are,
+// client errors (bad auth, 404s, etc.) are not.
+func (e *HTTPError) Retryable() bool {
+	return e.StatusCode >= 500
+}
+
+type retryabler interface {
+	Retryable() bool
+}
+
+// isRetryable treats anything that doesn't explicitly say otherwise
+// (network errors, timeouts, ...) as transient.
+func isRetryable(err error) bool {
+	if r, ok := err.(retryabler); ok {
+		return r.Retryable()
+	}
+	return true
+}
+
+type record struct {
+	SourceURL string `json:"sourceURL"`
+	TargetURL string `json:"targetURL"`
+}
+
+// Manager bounds concurrent transfers, retries failures with backoff, skips
+// transfers already completed (from this run or a checkpointed prior run),
+// and persists newly completed transfers to disk.
+type Manager struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+
+	checkpointPath string
+	checkpointFile *os.File
+	checkpointMu   sync.Mutex
+
+	mu        sync.Mutex
+	completed map[string]record
+	pending   map[string]bool
+	sem       chan struct{}
+}
+
+// NewManager creates a Manager bounded to concurrency simultaneous
+// transfers, loading any previously completed transfers from
+// checkpointPath if it exists. An empty checkpointPath disables
+// checkpointing.
+//
+// The checkpoint file is a JSON-lines log, one completed record per line,
+// so marking a transfer done only appends a line rather than rewriting
+// every record completed so far.
+func NewManager(checkpointPath string, concurrency int) (*Manager, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	m := &Manager{
+		MaxAttempts:    5,
+		BaseBackoff:    500 * time.Millisecond,
+		checkpointPath: checkpointPath,
+		completed:      make(map[string]record),
+		pending:        make(map[string]bool),
+		sem:            make(chan struct{}, concurrency),
+	}
+
+	if checkpointPath == "" {
+		return m, nil
+	}
+
+	if f, err := os.Open(checkpointPath); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			var r record
+			if err := json.Unmarshal(line, &r); err != nil {
+				f.Close()
+				return nil, err
+			}
+			m.completed[key(r.SourceURL, r.TargetURL)] = r
+		}
+		err := scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cf, err := os.OpenFile(checkpointPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	m.checkpointFile = cf
+
+	return m, nil
+}
+
+func key(sourceURL, targetURL string) string {
+	return sourceURL + "\x00" + targetURL
+}
+
+// Done reports whether sourceURL->targetURL has already been migrated,
+// either earlier in this run or in a checkpointed prior run.
+func (m *Manager) Done(sourceURL, targetURL string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.completed[key(sourceURL, targetURL)]
+	return ok
+}
+
+// Do runs fn for the sourceURL->targetURL transfer: it skips the transfer
+// if already completed or already in flight elsewhere in this run, blocks
+// until a concurrency slot is free, retries fn with exponential backoff on
+// retryable errors, and checkpoints the transfer on success. It returns nil
+// for a transfer it skips as a duplicate.
+func (m *Manager) Do(sourceURL, targetURL string, fn func() error) error {
+	k := key(sourceURL, targetURL)
+
+	m.mu.Lock()
+	if _, done := m.completed[k]; done {
+		m.mu.Unlock()
+		return nil
+	}
+	if m.pending[k] {
+		m.mu.Unlock()
+		return nil
+	}
+	m.pending[k] = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, k)
+		m.mu.Unlock()
+	}()
+
+	m.sem <- struct{}{}
+	defer func() { <-m.sem }()
+
+	backoff := m.BaseBackoff
+	var err error
+	for attempt := 1; attempt <= m.MaxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return m.markSucceeded(sourceURL, targetURL)
+		}
+		if !isRetryable(err) || attempt == m.MaxAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
+
+func (m *Manager) markSucceeded(sourceURL, targetURL string) error {
+	r := record{SourceURL: sourceURL, TargetURL: targetURL}
+
+	m.mu.Lock()
+	m.completed[key(sourceURL, targetURL)] = r
+	m.mu.Unlock()
+
+	return m.appendCheckpoint(r)
+}
+
+// appendCheckpoint adds r as one more line to the checkpoint file, so
+// persisting a completed transfer costs O(1) regardless of how many
+// transfers have completed before it.
+func (m *Manager) appendCheckpoint(r record) error {
+	if m.checkpointFile == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	m.checkpointMu.Lock()
+	defer m.checkpointMu.Unlock()
+	_, err = m.checkpointFile.Write(data)
+	return err
+}
@@ -1,42 +1,31 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"os"
-	"strings"
-)
-
-type Data struct {
-	Asset Asset `json:"data"`
-}
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-type Asset struct {
-	Type              string  `json:"type"`
-	Leaf              bool    `json:"leaf"`
-	NodeName          string  `json:"nodeName"`
-	Path              string  `json:"path"`
-	Children          []Asset `json:"children"`
-	RepositoryId      string  `json:"repositoryId"`
-	LocallyAvailable  bool    `json:"locallyAvailable"`
-	ArtifactTimestamp int     `json:"artifactTimestamp"`
-	ArtifactUri       string  `json:"artifactUri"`
-	PomUri            string  `json:"pomUri"`
-	GroupId           string  `json:"groupId"`
-	ArtifactId        string  `json:"artifactId"`
-	Version           string  `json:"version"`
-	Extension         string  `json:"extension"`
-	Packaing          string  `json:"packaging"`
-}
+	"github.com/robertojrojas/nexus-haul/internal/repoformat"
+	"github.com/robertojrojas/nexus-haul/internal/xfer"
+)
 
 type AssetToStream struct {
 	sourceURL   string
 	targetURL   string
 	contentType string
+	// hashes lists the checksum algorithms (e.g. "md5", "sha1", "sha256")
+	// to mirror or generate alongside this artifact.
+	hashes []string
 }
 
 type configFile struct {
@@ -44,6 +33,17 @@ type configFile struct {
 	TargetURL         string
 	SourceDownloadURL string
 	Workers           int
+	// CheckpointFile, if set, is where completed transfers are persisted so
+	// that a re-run of nexus-haul resumes instead of re-migrating artifacts
+	// that already made it to the target.
+	CheckpointFile string
+	// Hashes lists which checksum sidecars ("md5", "sha1", "sha256") are
+	// mirrored from the source (or generated, if the source lacks them)
+	// alongside every artifact.
+	Hashes []string
+	// Format selects the repository format being migrated: "maven2"
+	// (default), "raw", "npm", or "pypi".
+	Format string
 }
 
 type authFile struct {
@@ -60,14 +60,50 @@ type confInfo struct {
 
 var nexusMigratorConfigFile string
 var nexusMigratorAuthFile string
+var dryRun bool
+var quiet bool
+var logFormat string
+var shutdownGrace time.Duration
 
 var af authFile
 var cf configFile
 var ci confInfo
 
+// pipeline bundles the values every migration worker needs beyond its
+// channels: cancellation, structured logging, progress reporting, and
+// whether this is a --dry-run preview.
+type pipeline struct {
+	// ctx is attached to outbound HTTP requests. It is only canceled once
+	// the shutdown grace period elapses, so in-flight requests get a
+	// chance to finish after a signal is received.
+	ctx context.Context
+	// shutdown is canceled the moment SIGINT/SIGTERM arrives. Workers
+	// check it to stop pulling new work off their channels.
+	shutdown context.Context
+	logger   *slog.Logger
+	progress *Progress
+	dryRun   bool
+	// wg tracks every unit of outstanding work (a group still to be
+	// listed, an artifact still to be streamed). It reaches zero exactly
+	// when the migration is complete.
+	wg *sync.WaitGroup
+}
+
+// xm is the transfer manager that bounds, retries, de-duplicates, and
+// checkpoints every artifact streamed from source to target.
+var xm *xfer.Manager
+
+// rf is the repository format being migrated; it knows how to list a
+// source tree and address its assets for download/upload.
+var rf repoformat.Format
+
 func init() {
 	flag.StringVar(&nexusMigratorConfigFile, "migratorConfFile", "./migrator-conf.json", "File (JSON) containing configuration for the Nexus Artifact Migrator.")
 	flag.StringVar(&nexusMigratorAuthFile, "migratorAuthFile", "./migrator-auth.json", "File (JSON) containing authentication for the Nexus servers accessed by the Artifact Migrator.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Walk the source tree and print what would be migrated, without issuing any PUTs.")
+	flag.BoolVar(&quiet, "quiet", false, "Suppress the progress bar, even when stderr is a terminal.")
+	flag.StringVar(&logFormat, "log-format", "text", "Structured log output format: \"text\" or \"json\".")
+	flag.DurationVar(&shutdownGrace, "shutdown-grace", 30*time.Second, "How long to let in-flight transfers finish after SIGINT/SIGTERM before cancelling them.")
 
 }
 
@@ -75,39 +111,110 @@ func main() {
 
 	flag.Parse()
 
+	logger := newLogger(logFormat, os.Stderr)
+
 	processConfigAndAuthFiles()
 
 	downloadCh := make(chan string, 100)
 	unmarshalCh := make(chan []byte, 100)
-	processCh := make(chan Asset, 100)
+	processCh := make(chan repoformat.Asset, 100)
 	streamCh := make(chan AssetToStream, 100)
 	errCh := make(chan error)
 
 	workers := ci.configFile.Workers
 
+	var err error
+	xm, err = xfer.NewManager(ci.configFile.CheckpointFile, workers)
+	if err != nil {
+		logger.Error("loading checkpoint file", "error", err)
+		os.Exit(1)
+	}
+
+	rf, err = repoformat.New(ci.configFile.Format)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	shutdownCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// requestCtx backs in-flight HTTP requests. Unlike shutdownCtx, it is
+	// only canceled once the shutdown grace period elapses, so requests
+	// already underway get a chance to finish cleanly first.
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	var wg sync.WaitGroup
+	p := &pipeline{
+		ctx:      requestCtx,
+		shutdown: shutdownCtx,
+		logger:   logger,
+		progress: NewProgress(os.Stderr, quiet),
+		dryRun:   dryRun,
+		wg:       &wg,
+	}
+
 	for {
 		if workers < 1 {
 			break
 		}
 		workers--
-		go downloader(downloadCh, unmarshalCh, errCh)
-		go unmarshaler(unmarshalCh, processCh, errCh)
-		go processor(processCh, downloadCh, streamCh, errCh)
-		go streamer(streamCh, errCh)
+		go downloader(p, downloadCh, unmarshalCh, errCh)
+		go unmarshaler(p, unmarshalCh, processCh, errCh)
+		go processor(p, processCh, downloadCh, streamCh, errCh)
+		go streamer(p, streamCh, errCh)
 	}
 
 	// Kick it off!
+	wg.Add(1)
 	downloadCh <- ci.configFile.SourceURL
 
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
 	for {
 		select {
 		case err := <-errCh:
-			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			logger.Error(err.Error())
+
+		case <-done:
+			p.progress.Finish()
+			if failed := p.progress.Failed(); failed > 0 {
+				logger.Error("migration complete with failed transfers", "failed", failed)
+				os.Exit(1)
+			}
+			logger.Info("migration complete")
+			os.Exit(0)
+
+		case <-shutdownCtx.Done():
+			logger.Warn("shutdown requested, draining in-flight transfers", "grace", shutdownGrace)
+			select {
+			case <-done:
+				logger.Info("drained cleanly after shutdown signal")
+			case <-time.After(shutdownGrace):
+				logger.Warn("grace period elapsed, abandoning remaining in-flight transfers")
+				cancelRequests()
+			}
+			p.progress.Finish()
+			os.Exit(1)
 		}
 	}
 
 }
 
+// newLogger builds the slog.Logger used for structured, per-transfer audit
+// events. format selects "json" or defaults to human-readable text.
+func newLogger(format string, w io.Writer) *slog.Logger {
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, nil))
+	}
+	return slog.New(slog.NewTextHandler(w, nil))
+}
+
 func processConfigAndAuthFiles() error {
 	cf = configFile{}
 	af = authFile{}
@@ -148,113 +255,237 @@ func readFile(filename string) ([]byte, error) {
 	return data, nil
 }
 
-func processor(processCh chan Asset, downloadCh chan string, streamCh chan AssetToStream, errCh chan error) {
+func processor(p *pipeline, processCh chan repoformat.Asset, downloadCh chan string, streamCh chan AssetToStream, errCh chan error) {
 	for {
 		select {
+		case <-p.shutdown.Done():
+			return
+		default:
+		}
+
+		select {
+		case <-p.shutdown.Done():
+			return
+
 		case asset := <-processCh:
-			//fmt.Println("processor", "asset")
-			if hasArtifacts(&asset) {
-				//fmt.Println("processor", "hasArtifacts")
-				artifacts := getArtifacts(&asset)
-				for _, artifact := range artifacts {
-					sURL := fmt.Sprintf("%s%s", ci.configFile.SourceDownloadURL, artifact)
-					tURL := fmt.Sprintf("%s%s", ci.configFile.TargetURL, artifact)
-					contentType := "application/java-archive"
-					if strings.HasSuffix(artifact, ".pom") {
-						contentType = "application/xml"
-					}
-					assetToStream := AssetToStream{
-						sourceURL:   sURL,
-						targetURL:   tURL,
-						contentType: contentType,
-					}
-					//fmt.Println("processor", "hasArtifacts", "assetToStream")
-					streamCh <- assetToStream
+			// A listing can mix leaves with still-unexpanded groups at the
+			// same level (e.g. raw repository folders), so both are
+			// handled for every asset rather than picking one branch.
+			for _, artifact := range repoformat.Artifacts(asset) {
+				assetToStream := AssetToStream{
+					sourceURL:   rf.DownloadURL(ci.configFile.SourceDownloadURL, artifact),
+					targetURL:   rf.UploadURL(ci.configFile.TargetURL, artifact),
+					contentType: rf.ContentType(artifact),
+					hashes:      ci.configFile.Hashes,
 				}
-			} else {
-				groups := getGroups(&asset)
-				for _, g := range groups {
-					rootURL := fmt.Sprintf("%s%s", ci.configFile.SourceURL, g)
-					//fmt.Printf("rootURL: %s\n", rootURL)
-					downloadCh <- rootURL
+				p.progress.AssetDiscovered()
+
+				if p.dryRun {
+					fmt.Printf("%s -> %s (%s)\n", assetToStream.sourceURL, assetToStream.targetURL, assetToStream.contentType)
+					continue
 				}
+
+				p.wg.Add(1)
+				streamCh <- assetToStream
 			}
+			for _, g := range repoformat.Groups(asset) {
+				rootURL := rf.ListURL(ci.configFile.SourceURL, g)
+				p.wg.Add(1)
+				downloadCh <- rootURL
+			}
+			// This asset's own work is done; anything it spawned already
+			// holds its own wg slot.
+			p.wg.Done()
 		}
 	}
 }
 
-func streamer(streamCh chan AssetToStream, errCh chan error) {
+func streamer(p *pipeline, streamCh chan AssetToStream, errCh chan error) {
 	for {
 		select {
+		case <-p.shutdown.Done():
+			return
+		default:
+		}
+
+		select {
+		case <-p.shutdown.Done():
+			return
+
 		case assetToStream := <-streamCh:
-			//fmt.Printf("streaming from: %s\n", assetToStream.sourceURL)
-			// Get the data
-			req, err := http.NewRequest("GET", assetToStream.sourceURL, nil)
+			n, err := streamOne(p.ctx, assetToStream)
 			if err != nil {
+				p.progress.TransferFailed()
+				p.logger.Error("transfer", "source", assetToStream.sourceURL, "target", assetToStream.targetURL, "outcome", "failed", "error", err)
 				errCh <- err
-				continue
+			} else {
+				p.progress.TransferSucceeded(n)
+				p.logger.Info("transfer", "source", assetToStream.sourceURL, "target", assetToStream.targetURL, "outcome", "succeeded", "bytes", n)
 			}
+			p.wg.Done()
+		}
+	}
 
-			req.SetBasicAuth(ci.authFile.SourceUser, ci.authFile.SourcePassword)
-			req.Header.Add("Accept", `application/json`)
+}
 
-			client := &http.Client{}
-			resp, err := client.Do(req)
-			if err != nil {
-				errCh <- err
-				continue
-			}
+// streamOne streams one artifact from source to target through the transfer
+// manager, which supplies the retry/backoff, dedup, and checkpointing around
+// streamOnce's single, unretried attempt. It returns the number of bytes the
+// last attempt uploaded (0 for a transfer skipped as already done).
+func streamOne(ctx context.Context, assetToStream AssetToStream) (int64, error) {
+	var uploaded int64
+	err := xm.Do(assetToStream.sourceURL, assetToStream.targetURL, func() error {
+		n, err := streamOnce(ctx, assetToStream)
+		uploaded = n
+		return err
+	})
+	return uploaded, err
+}
 
-			defer resp.Body.Close()
-			err = httpUpload(assetToStream.targetURL, resp.Body, assetToStream.contentType)
-			if err != nil {
-				errCh <- err
-				continue
-			}
+func streamOnce(ctx context.Context, assetToStream AssetToStream) (int64, error) {
+	// Get the data
+	req, err := http.NewRequest("GET", assetToStream.sourceURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+
+	req.SetBasicAuth(ci.authFile.SourceUser, ci.authFile.SourcePassword)
+	req.Header.Add("Accept", `application/json`)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return 0, &xfer.HTTPError{URL: assetToStream.sourceURL, StatusCode: resp.StatusCode, Body: string(b)}
+	}
+
+	counted := &countingReader{r: resp.Body}
+
+	if len(assetToStream.hashes) == 0 {
+		if err := httpUpload(ctx, assetToStream.targetURL, counted, assetToStream.contentType); err != nil {
+			return counted.n, err
 		}
+		return counted.n, nil
 	}
 
+	// A source checksum must be verified before anything reaches the
+	// target, so the artifact is buffered to disk while hashing rather
+	// than streamed straight into the upload: once bytes are PUT there is
+	// no undoing a mismatch.
+	expected, err := expectedChecksums(ctx, assetToStream)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := ioutil.TempFile("", "nexus-haul-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sums := newHashSet(assetToStream.hashes)
+	body := io.TeeReader(counted, sums.Writer())
+	if _, err := io.Copy(tmp, body); err != nil {
+		return counted.n, err
+	}
+	computed := sums.Sums()
+
+	if err := verifyChecksums(assetToStream, expected, computed); err != nil {
+		return counted.n, err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return counted.n, err
+	}
+	if err := httpUpload(ctx, assetToStream.targetURL, tmp, assetToStream.contentType); err != nil {
+		return counted.n, err
+	}
+
+	if err := streamSidecars(ctx, assetToStream, expected, computed); err != nil {
+		return counted.n, err
+	}
+	return counted.n, nil
+}
+
+// countingReader counts the bytes read through it, so callers can report
+// transfer sizes without buffering the whole body in memory.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
-func unmarshaler(unmarshalCh chan []byte, processCh chan Asset, errCh chan error) {
+func unmarshaler(p *pipeline, unmarshalCh chan []byte, processCh chan repoformat.Asset, errCh chan error) {
 	for {
 		select {
+		case <-p.shutdown.Done():
+			return
+		default:
+		}
+
+		select {
+		case <-p.shutdown.Done():
+			return
+
 		case data := <-unmarshalCh:
-			//fmt.Println("unmarshaler", "data")
-			dataObj := Data{}
-			err := json.Unmarshal(data, &dataObj)
+			asset, err := rf.ParseListing(data)
 			if err != nil {
+				// Dead end: this download's work will never reach the
+				// processor to spawn further work.
+				p.wg.Done()
 				errCh <- err
-			} else {
-				processCh <- dataObj.Asset
+				continue
 			}
+			processCh <- asset
 		}
 	}
 
 }
 
-func downloader(downloadCh chan string, unmarshalCh chan []byte, errCh chan error) {
+func downloader(p *pipeline, downloadCh chan string, unmarshalCh chan []byte, errCh chan error) {
 	for {
 		select {
+		case <-p.shutdown.Done():
+			return
+		default:
+		}
+
+		select {
+		case <-p.shutdown.Done():
+			return
+
 		case url := <-downloadCh:
-			fmt.Println("downloader", "url", url)
-			data, err := httpDownload(url)
+			p.logger.Debug("listing", "url", url)
+			data, err := httpDownload(p.ctx, url)
 			if err != nil {
+				p.wg.Done()
 				errCh <- err
-			} else {
-				unmarshalCh <- data
+				continue
 			}
+			unmarshalCh <- data
 		}
 	}
 }
 
-func httpDownload(url string) ([]byte, error) {
-	//fmt.Printf("downloading: %s\n", url)
+func httpDownload(ctx context.Context, url string) ([]byte, error) {
 	// Get the data
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	req.SetBasicAuth(ci.authFile.SourceUser, ci.authFile.SourcePassword)
 	req.Header.Add("Accept", `application/json`)
@@ -267,7 +498,6 @@ func httpDownload(url string) ([]byte, error) {
 
 	defer resp.Body.Close()
 
-	//fmt.Printf("res.StatusCode: %d\n", resp.StatusCode)
 	if resp.StatusCode != http.StatusOK {
 		b, _ := ioutil.ReadAll(resp.Body)
 		err = fmt.Errorf("URL:[%s], StatusCode:[%d], [%s]", url, resp.StatusCode, string(b))
@@ -279,13 +509,13 @@ func httpDownload(url string) ([]byte, error) {
 	return data, nil
 }
 
-func httpUpload(url string, body io.Reader, contentType string) error {
-	fmt.Printf("streaming TO: %s\n", url)
+func httpUpload(ctx context.Context, url string, body io.Reader, contentType string) error {
 	// POST the data
 	req, err := http.NewRequest("PUT", url, body)
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
 	req.SetBasicAuth(ci.authFile.TargetUser, ci.authFile.TargetPassword)
 	req.Header.Set("Content-Type", contentType)
 
@@ -301,54 +531,8 @@ func httpUpload(url string, body io.Reader, contentType string) error {
 	//fmt.Printf("res.StatusCode: %d\n", resp.StatusCode)
 	if resp.StatusCode != http.StatusCreated {
 		b, _ := ioutil.ReadAll(resp.Body)
-		err = fmt.Errorf("URL:[%s], StatusCode:[%d], [%s]", url, resp.StatusCode, string(b))
-		return err
+		return &xfer.HTTPError{URL: url, StatusCode: resp.StatusCode, Body: string(b)}
 	}
 
 	return nil
 }
-
-func getArtifacts(asset *Asset) []string {
-	artifacts := make([]string, 0)
-	for _, a := range asset.Children {
-		if a.Leaf {
-			artifactURI := a.Path[1:]
-			artifacts = append(artifacts, artifactURI)
-			//fmt.Println("getArtifacts", "adding", artifactURI)
-			if len(a.PomUri) > 0 {
-				pomURI := strings.Replace(artifactURI, "jar", "pom", 1)
-				artifacts = append(artifacts, pomURI)
-				//fmt.Println("getArtifacts", "adding", artifactURI)
-			}
-		} else {
-			//fmt.Printf("Group: %s %s\n", a.Type, a.Path)
-			artifacts = append(artifacts, getArtifacts(&a)...)
-		}
-	}
-	//fmt.Printf("getArtifacts: %s %d\n", asset.Path, len(artifacts))
-	return artifacts
-}
-
-func getGroups(asset *Asset) []string {
-	//fmt.Println("getGroups", asset.Path)
-	groups := make([]string, 0)
-	for _, a := range asset.Children {
-		if a.Type == "G" {
-			groups = append(groups, a.Path[1:])
-		}
-	}
-	//fmt.Println("getGroups.len", len(groups))
-	return groups
-}
-
-func hasArtifacts(asset *Asset) bool {
-	for _, a := range asset.Children {
-		if a.Leaf {
-			return true
-		} else {
-			return hasArtifacts(&a)
-		}
-	}
-
-	return false
-}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Progress aggregates migration counters and renders them as a single
+// updating line on stderr, when stderr is a TTY and reporting hasn't been
+// silenced with --quiet.
+type Progress struct {
+	quiet bool
+	tty   bool
+	out   io.Writer
+	start time.Time
+
+	discovered int64
+	succeeded  int64
+	failed     int64
+	bytes      int64
+}
+
+// NewProgress creates a Progress that renders to out. Rendering is a no-op
+// whenever quiet is set or out isn't a terminal.
+func NewProgress(out io.Writer, quiet bool) *Progress {
+	return &Progress{
+		quiet: quiet,
+		tty:   isTerminal(out),
+		out:   out,
+		start: time.Now(),
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// AssetDiscovered records one more artifact found while walking the source
+// tree.
+func (p *Progress) AssetDiscovered() {
+	atomic.AddInt64(&p.discovered, 1)
+	p.render()
+}
+
+// TransferSucceeded records a completed transfer of n bytes.
+func (p *Progress) TransferSucceeded(n int64) {
+	atomic.AddInt64(&p.succeeded, 1)
+	atomic.AddInt64(&p.bytes, n)
+	p.render()
+}
+
+// TransferFailed records a transfer that gave up after retries.
+func (p *Progress) TransferFailed() {
+	atomic.AddInt64(&p.failed, 1)
+	p.render()
+}
+
+// Failed returns how many transfers have given up after retries so far.
+func (p *Progress) Failed() int64 {
+	return atomic.LoadInt64(&p.failed)
+}
+
+func (p *Progress) render() {
+	if p.quiet || !p.tty {
+		return
+	}
+
+	discovered := atomic.LoadInt64(&p.discovered)
+	succeeded := atomic.LoadInt64(&p.succeeded)
+	failed := atomic.LoadInt64(&p.failed)
+	bytes := atomic.LoadInt64(&p.bytes)
+
+	elapsed := time.Since(p.start)
+	throughputKBs := float64(bytes) / 1024 / elapsed.Seconds()
+
+	var eta time.Duration
+	if succeeded > 0 && discovered > succeeded {
+		perTransfer := elapsed / time.Duration(succeeded)
+		eta = perTransfer * time.Duration(discovered-succeeded)
+	}
+
+	fmt.Fprintf(p.out, "\rtransferred %d/%d discovered (failed %d) | %.1f KB/s | ETA %s   ",
+		succeeded, discovered, failed, throughputKBs, eta.Round(time.Second))
+}
+
+// Finish prints a trailing newline so later output doesn't land on the
+// progress line.
+func (p *Progress) Finish() {
+	if p.quiet || !p.tty {
+		return
+	}
+	fmt.Fprintln(p.out)
+}